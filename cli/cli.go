@@ -1,60 +1,71 @@
 package cli
 
 import (
-	"code.google.com/p/google-api-go-client/drive/v2"
 	"fmt"
-	"github.com/prasmussen/gdrive/gdrive"
-	"github.com/prasmussen/gdrive/util"
 	"io"
 	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+
+	"github.com/prasmussen/gdrive/gdrive"
+	"github.com/prasmussen/gdrive/util"
 )
 
+// listFields is the partial response requested from Files.List so that
+// large listings don't pay for fields we never display.
+const listFields = "files(id,name,size,md5Checksum,trashed,modifiedTime,mimeType)"
+
+// infoFields is the fuller set of fields needed to print a single file's
+// details (Files.Get only returns a small default subset in v3, so we have
+// to ask for the rest explicitly).
+const infoFields = "id,name,description,size,createdTime,modifiedTime,owners,md5Checksum,parents,mimeType,trashed"
+
 func List(d *gdrive.Drive, query, titleFilter string, maxResults int, sharedStatus bool, noHeader bool) error {
-	caller := d.Files.List()
+	caller := scopedList(d).Fields(googleapi.Field(listFields))
 
 	if maxResults > 0 {
-		caller.MaxResults(int64(maxResults))
+		caller.PageSize(int64(maxResults))
 	}
 
-	if titleFilter != "" {
-		q := fmt.Sprintf("title contains '%s'", titleFilter)
+	if q := buildListQuery(query, titleFilter); q != "" {
 		caller.Q(q)
 	}
 
-	if query != "" {
-		caller.Q(query)
-	}
-
-	list, err := caller.Do()
+	var list *drive.FileList
+	err := gdrive.Pace(func() (err error) {
+		list, err = caller.Do()
+		return
+	})
 	if err != nil {
 		return err
 	}
 
 	items := make([]map[string]string, 0, 0)
 
-	for _, f := range list.Items {
-		// Skip files that dont have a download url (they are not stored on google drive)
-		if f.DownloadUrl == "" {
-			if f.MimeType != "application/vnd.google-apps.folder" {
-				continue
-			}
+	for _, f := range list.Files {
+		// Skip native Google Docs/Sheets/Slides files (they have no binary
+		// content of their own) unless they are folders.
+		if isGoogleAppsMimeType(f.MimeType) && f.MimeType != gdrive.FolderMimeType {
+			continue
 		}
-		if f.Labels.Trashed {
+		if f.Trashed {
 			continue
 		}
 
 		items = append(items, map[string]string{
-			"Id":      f.Id,
-			"Title":   util.TruncateString(f.Title, 40),
-			"Size":    util.FileSizeFormat(f.FileSize),
-			"Created": util.ISODateToLocal(f.CreatedDate),
+			"Id":       f.Id,
+			"Title":    util.TruncateString(f.Name, 40),
+			"Size":     util.FileSizeFormat(f.Size),
+			"Modified": util.ISODateToLocal(f.ModifiedTime),
 		})
 	}
 
-	columnOrder := []string{"Id", "Title", "Size", "Created"}
+	columnOrder := []string{"Id", "Title", "Size", "Modified"}
 
 	if sharedStatus {
 		addSharedStatus(d, items)
@@ -65,6 +76,89 @@ func List(d *gdrive.Drive, query, titleFilter string, maxResults int, sharedStat
 	return nil
 }
 
+func isGoogleAppsMimeType(mimeType string) bool {
+	return strings.HasPrefix(mimeType, gdrive.GoogleAppsMimePrefix)
+}
+
+// buildListQuery combines the title filter and a user-supplied query into a
+// single Drive query string, ANDing them together rather than letting one
+// silently replace the other.
+func buildListQuery(query, titleFilter string) string {
+	clauses := make([]string, 0, 2)
+	if titleFilter != "" {
+		clauses = append(clauses, fmt.Sprintf("name contains '%s'", titleFilter))
+	}
+	if query != "" {
+		clauses = append(clauses, "("+query+")")
+	}
+	return strings.Join(clauses, " and ")
+}
+
+// scopedList and friends below apply the supportsAllDrives/corpora/driveId
+// parameters Shared Drives need to each call, so the rest of the file can
+// build queries without worrying about Team Drive scoping.
+
+func scopedList(d *gdrive.Drive) *drive.FilesListCall {
+	call := d.Files.List()
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+		if d.TeamDriveId != "" {
+			call.Corpora("drive").DriveId(d.TeamDriveId)
+		} else {
+			call.Corpora("allDrives")
+		}
+	}
+	return call
+}
+
+func scopedGet(d *gdrive.Drive, fileId string) *drive.FilesGetCall {
+	call := d.Files.Get(fileId)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
+func scopedCreate(d *gdrive.Drive, f *drive.File) *drive.FilesCreateCall {
+	call := d.Files.Create(f)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
+func scopedDelete(d *gdrive.Drive, fileId string) *drive.FilesDeleteCall {
+	call := d.Files.Delete(fileId)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
+func scopedPermList(d *gdrive.Drive, fileId string) *drive.PermissionsListCall {
+	call := d.Permissions.List(fileId)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
+func scopedPermCreate(d *gdrive.Drive, fileId string, perm *drive.Permission) *drive.PermissionsCreateCall {
+	call := d.Permissions.Create(fileId, perm)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
+func scopedPermDelete(d *gdrive.Drive, fileId, permissionId string) *drive.PermissionsDeleteCall {
+	call := d.Permissions.Delete(fileId, permissionId)
+	if d.TeamDriveScoped() {
+		call.SupportsAllDrives(true)
+	}
+	return call
+}
+
 // Adds the key-value-pair 'Shared: True/False' to the map
 func addSharedStatus(d *gdrive.Drive, items []map[string]string) {
 	// Limit to 10 simultaneous requests
@@ -97,7 +191,11 @@ func addSharedStatus(d *gdrive.Drive, items []map[string]string) {
 }
 
 func Info(d *gdrive.Drive, fileId string) error {
-	info, err := d.Files.Get(fileId).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedGet(d, fileId).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
@@ -106,14 +204,19 @@ func Info(d *gdrive.Drive, fileId string) error {
 }
 
 func printInfo(d *gdrive.Drive, f *drive.File) {
+	owners := make([]string, 0, len(f.Owners))
+	for _, owner := range f.Owners {
+		owners = append(owners, owner.DisplayName)
+	}
+
 	fields := map[string]string{
 		"Id":          f.Id,
-		"Title":       f.Title,
+		"Title":       f.Name,
 		"Description": f.Description,
-		"Size":        util.FileSizeFormat(f.FileSize),
-		"Created":     util.ISODateToLocal(f.CreatedDate),
-		"Modified":    util.ISODateToLocal(f.ModifiedDate),
-		"Owner":       strings.Join(f.OwnerNames, ", "),
+		"Size":        util.FileSizeFormat(f.Size),
+		"Created":     util.ISODateToLocal(f.CreatedTime),
+		"Modified":    util.ISODateToLocal(f.ModifiedTime),
+		"Owner":       strings.Join(owners, ", "),
 		"Md5sum":      f.Md5Checksum,
 		"Shared":      util.FormatBool(isShared(d, f.Id)),
 		"Parents":     util.ParentList(f.Parents),
@@ -141,20 +244,23 @@ func Folder(d *gdrive.Drive, title string, parentId string, share bool) error {
 		return err
 	}
 	printInfo(d, info)
-	fmt.Printf("Folder '%s' created\n", info.Title)
+	fmt.Printf("Folder '%s' created\n", info.Name)
 	return nil
 }
 
 func makeFolder(d *gdrive.Drive, title string, parentId string, share bool) (*drive.File, error) {
 	// File instance
-	f := &drive.File{Title: title, MimeType: "application/vnd.google-apps.folder"}
+	f := &drive.File{Name: title, MimeType: gdrive.FolderMimeType}
 	// Set parent (if provided)
 	if parentId != "" {
-		p := &drive.ParentReference{Id: parentId}
-		f.Parents = []*drive.ParentReference{p}
+		f.Parents = []string{parentId}
 	}
 	// Create folder
-	info, err := d.Files.Insert(f).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedCreate(d, f).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return nil, fmt.Errorf("An error occurred creating the folder: %v\n", err)
 	}
@@ -166,7 +272,8 @@ func makeFolder(d *gdrive.Drive, title string, parentId string, share bool) (*dr
 }
 
 // Upload file to drive
-func Upload(d *gdrive.Drive, input io.ReadCloser, title string, parentId string, share bool, mimeType string, convert bool) error {
+func Upload(d *gdrive.Drive, input io.ReadCloser, title string, parentId string, share bool, mimeType string, convert bool, force bool, deleteOnMismatch bool) error {
+	defer input.Close()
 
 	// Use filename or 'untitled' as title if no title is specified
 	f2, ok := input.(*os.File)
@@ -178,43 +285,9 @@ func Upload(d *gdrive.Drive, input io.ReadCloser, title string, parentId string,
 				return err
 			}
 			if fi.Mode().IsDir() {
-				// then upload the entire directory, calling Upload recursively
-				// make dir first
-				folder, err := makeFolder(d, filepath.Base(f2.Name()), parentId, share)
-				if err != nil {
-					return err
-				}
-				currDir, err := os.Getwd()
-				if err != nil {
-					return err
-				}
-
-				files, err := f2.Readdir(0)
-				if err != nil {
-					return err
-				}
-				// need to change dirs to get the files in the dir
-				err = f2.Chdir()
-				if err != nil {
-					return err
-				}
-				for _, el := range files {
-					if el.IsDir() {
-						// todo: recursively do this, would need to keep track of parent ids for new directories
-					} else {
-						f2, err := os.Open(el.Name())
-						if err != nil {
-							return err
-						}
-						Upload(d, f2, filepath.Base(el.Name()), folder.Id, share, mimeType, convert)
-					}
-				}
-				// go back to previous dir
-				err = os.Chdir(currDir)
-				if err != nil {
-					return err
-				}
-				return nil
+				// Walk and upload the entire tree, recreating folders on
+				// demand as we go.
+				return uploadTree(d, f2.Name(), parentId, share, mimeType, convert, force, deleteOnMismatch)
 			}
 			// normal file, not a directory
 			title = filepath.Base(f2.Name())
@@ -228,31 +301,94 @@ func Upload(d *gdrive.Drive, input io.ReadCloser, title string, parentId string,
 		mimeType = mime.TypeByExtension(filepath.Ext(title))
 	}
 
+	// For a regular file that isn't being converted to a native Docs format
+	// (conversion changes the uploaded bytes, so Drive never reports a
+	// checksum for the result), hash it up front and skip the upload
+	// entirely if an identical file is already sitting in the target
+	// parent.
+	var localMd5 string
+	if ok && input != os.Stdin && !convert {
+		sum, err := util.Md5File(f2.Name())
+		if err != nil {
+			return err
+		}
+		localMd5 = sum
+
+		if !force {
+			existing, err := findExisting(d, title, parentId)
+			if err != nil {
+				return err
+			}
+			if existing != nil && existing.Md5Checksum == localMd5 {
+				fmt.Printf("Skipping '%s': identical file already exists, use --force to upload anyway\n", title)
+				return nil
+			}
+		}
+	}
+
 	// File instance
-	f := &drive.File{Title: title, MimeType: mimeType}
+	f := &drive.File{Name: title, MimeType: mimeType}
 	// Set parent (if provided)
 	if parentId != "" {
-		p := &drive.ParentReference{Id: parentId}
-		f.Parents = []*drive.ParentReference{p}
+		f.Parents = []string{parentId}
 	}
 	getRate := util.MeasureTransferRate()
 
 	if convert {
 		fmt.Printf("Converting to Google Docs format enabled\n")
+		f.MimeType = googleDocsMimeType(mimeType)
 	}
 
-	info, err := d.Files.Insert(f).Convert(convert).Media(input).Do()
+	var info *drive.File
+	var err error
+	if ok && input != os.Stdin {
+		// Regular file with a known size: upload it in resumable chunks so a
+		// dropped connection only costs the current chunk, not the whole
+		// transfer.
+		info, err = d.ResumableUpload(f, f2, gdrive.DefaultChunkSize, gdrive.DefaultUploadStateFile(), func(offset int64) {
+			fmt.Printf("\rUploaded %s at %s", util.FileSizeFormat(offset), getRate(offset))
+		})
+		fmt.Println()
+		if err == nil {
+			// The resumable upload's response only carries Drive's default
+			// fields, so fetch the rest (md5Checksum, size, ...) for the
+			// checks and output below.
+			err = gdrive.Pace(func() (err error) {
+				info, err = scopedGet(d, info.Id).Fields(googleapi.Field(infoFields)).Do()
+				return
+			})
+		}
+	} else {
+		err = gdrive.Pace(func() (err error) {
+			info, err = scopedCreate(d, f).Media(input).Fields(googleapi.Field(infoFields)).Do()
+			return
+		})
+	}
 	if err != nil {
 		return fmt.Errorf("An error occurred uploading the document: %v\n", err)
 	}
 
+	// Verify the server-side checksum against what we hashed locally before
+	// the transfer started. A mismatch means the upload got corrupted in
+	// transit; with deleteOnMismatch the half-uploaded file is removed
+	// rather than left behind looking like a good copy.
+	if localMd5 != "" && info.Md5Checksum != "" && info.Md5Checksum != localMd5 {
+		if !deleteOnMismatch {
+			return fmt.Errorf("An error occurred: checksum mismatch after uploading '%s'\n", info.Name)
+		}
+		if delErr := gdrive.Pace(func() error { return scopedDelete(d, info.Id).Do() }); delErr != nil {
+			return fmt.Errorf("An error occurred: checksum mismatch after uploading '%s', and failed to remove the partial upload: %v\n", info.Name, delErr)
+		}
+		return fmt.Errorf("An error occurred: checksum mismatch after uploading '%s', removed partial upload\n", info.Name)
+	}
+
 	// Total bytes transferred
-	bytes := info.FileSize
+	bytes := info.Size
 
 	// Print information about uploaded file
 	printInfo(d, info)
 	fmt.Printf("MIME Type: %s\n", mimeType)
-	fmt.Printf("Uploaded '%s' at %s, total %s\n", info.Title, getRate(bytes), util.FileSizeFormat(bytes))
+	fmt.Printf("Uploaded '%s' at %s, total %s\n", info.Name, getRate(bytes), util.FileSizeFormat(bytes))
 
 	// Share file if the share flag was provided
 	if share {
@@ -261,38 +397,161 @@ func Upload(d *gdrive.Drive, input io.ReadCloser, title string, parentId string,
 	return err
 }
 
+// findExisting looks up a non-trashed file named title directly under
+// parentId (or the root folder, if parentId is empty), so Upload can compare
+// checksums against it before re-uploading. Returns nil if there's no match.
+func findExisting(d *gdrive.Drive, title, parentId string) (*drive.File, error) {
+	parent := parentId
+	if parent == "" {
+		parent = "root"
+	}
+	q := fmt.Sprintf("name='%s' and '%s' in parents and trashed=false", title, parent)
+
+	var list *drive.FileList
+	err := gdrive.Pace(func() (err error) {
+		list, err = scopedList(d).Q(q).Fields(googleapi.Field(listFields)).Do()
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(list.Files) == 0 {
+		return nil, nil
+	}
+	return list.Files[0], nil
+}
+
+// googleDocsMimeType maps a source file's mime type to the native Google
+// Docs format Drive should convert it to on upload. Types with no Docs
+// equivalent are uploaded as-is, since v3 dropped the old Convert() param
+// in favor of asking for the target native mime type directly.
+func googleDocsMimeType(sourceMimeType string) string {
+	switch sourceMimeType {
+	case "application/msword",
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document":
+		return "application/vnd.google-apps.document"
+	case "application/vnd.ms-excel",
+		"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+		"text/csv":
+		return "application/vnd.google-apps.spreadsheet"
+	case "application/vnd.ms-powerpoint",
+		"application/vnd.openxmlformats-officedocument.presentationml.presentation":
+		return "application/vnd.google-apps.presentation"
+	default:
+		return sourceMimeType
+	}
+}
+
+// uploadTree walks the local directory rooted at root, recreating each
+// subdirectory on Drive as it's encountered and uploading every file under
+// it. A local-path-to-folder-id cache means sibling files and folders never
+// need to re-resolve their parent.
+func uploadTree(d *gdrive.Drive, root string, parentId string, share bool, mimeType string, convert bool, force bool, deleteOnMismatch bool) error {
+	rootInfo, err := makeFolder(d, filepath.Base(root), parentId, share)
+	if err != nil {
+		return err
+	}
+
+	folderIds := map[string]string{root: rootInfo.Id}
+
+	return filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+
+		parentFolderId, ok := folderIds[filepath.Dir(path)]
+		if !ok {
+			return fmt.Errorf("An error occurred: no cached folder id for '%s'\n", filepath.Dir(path))
+		}
+
+		if fi.IsDir() {
+			folder, err := makeFolder(d, fi.Name(), parentFolderId, share)
+			if err != nil {
+				return err
+			}
+			folderIds[path] = folder.Id
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		return Upload(d, file, fi.Name(), parentFolderId, share, mimeType, convert, force, deleteOnMismatch)
+	})
+}
+
 func DownloadLatest(d *gdrive.Drive, stdout bool) error {
-	list, err := d.Files.List().Do()
+	var list *drive.FileList
+	err := gdrive.Pace(func() (err error) {
+		list, err = scopedList(d).Fields(googleapi.Field(listFields)).Do()
+		return
+	})
 	if err != nil {
 		return err
 	}
 
-	if len(list.Items) == 0 {
+	if len(list.Files) == 0 {
 		return fmt.Errorf("No files found")
 	}
 
-	latestId := list.Items[0].Id
-	return Download(d, latestId, stdout, true)
+	latestId := list.Files[0].Id
+	return Download(d, latestId, stdout, true, "")
 }
 
-// Download file from drive
-func Download(d *gdrive.Drive, fileId string, stdout, deleteAfterDownload bool) error {
+// Download file from drive. exportFormats is a comma separated list of
+// extensions (e.g. "docx,pdf") used to pick an export mime type when fileId
+// refers to a native Google Docs/Sheets/Slides file; it's ignored for
+// ordinary binary files.
+func Download(d *gdrive.Drive, fileId string, stdout, deleteAfterDownload bool, exportFormats string) error {
 	// Get file info
-	info, err := d.Files.Get(fileId).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedGet(d, fileId).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
-	if info.DownloadUrl == "" {
-		// If there is no DownloadUrl, there is no body
-		return fmt.Errorf("An error occurred: File is not downloadable")
+	if info.MimeType == gdrive.FolderMimeType {
+		if stdout {
+			return fmt.Errorf("An error occurred: '%s' is a folder and can't be written to stdout\n", info.Name)
+		}
+		return downloadFolder(d, info, ".", make(map[string]bool), exportFormats, make(map[string]bool))
+	}
+
+	if isGoogleAppsMimeType(info.MimeType) {
+		return exportDownload(d, info, stdout, exportFormats, ".")
+	}
+
+	// If a local file by this name already exists, skip the transfer
+	// entirely when its checksum matches what's on Drive -- otherwise keep
+	// refusing to clobber it.
+	if !stdout && util.FileExists(info.Name) {
+		localMd5, md5Err := util.Md5File(info.Name)
+		if md5Err == nil && info.Md5Checksum != "" && localMd5 == info.Md5Checksum {
+			fmt.Printf("Skipping '%s': local file already matches\n", info.Name)
+			if deleteAfterDownload {
+				return Delete(d, fileId)
+			}
+			return nil
+		}
+		return fmt.Errorf("An error occurred: '%s' already exists\n", info.Name)
 	}
 
 	// Measure transfer rate
 	getRate := util.MeasureTransferRate()
 
-	// GET the download url
-	res, err := d.Client().Get(info.DownloadUrl)
+	// GET the file content (files.get?alt=media)
+	var res *http.Response
+	err = gdrive.Pace(func() (err error) {
+		res, err = scopedGet(d, fileId).Download()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
@@ -306,13 +565,8 @@ func Download(d *gdrive.Drive, fileId string, stdout, deleteAfterDownload bool)
 		return nil
 	}
 
-	// Check if file exists
-	if util.FileExists(info.Title) {
-		return fmt.Errorf("An error occurred: '%s' already exists\n", info.Title)
-	}
-
 	// Create a new file
-	outFile, err := os.Create(info.Title)
+	outFile, err := os.Create(info.Name)
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
@@ -326,7 +580,7 @@ func Download(d *gdrive.Drive, fileId string, stdout, deleteAfterDownload bool)
 		return fmt.Errorf("An error occurred: %s", err)
 	}
 
-	fmt.Printf("Downloaded '%s' at %s, total %s\n", info.Title, getRate(bytes), util.FileSizeFormat(bytes))
+	fmt.Printf("Downloaded '%s' at %s, total %s\n", info.Name, getRate(bytes), util.FileSizeFormat(bytes))
 
 	if deleteAfterDownload {
 		err = Delete(d, fileId)
@@ -334,69 +588,249 @@ func Download(d *gdrive.Drive, fileId string, stdout, deleteAfterDownload bool)
 	return err
 }
 
+// exportDownload downloads a native Google Docs/Sheets/Slides file by
+// exporting it to the first format in exportFormats that Drive supports for
+// that file, appending the matching extension to its name and writing it
+// under destDir.
+func exportDownload(d *gdrive.Drive, info *drive.File, stdout bool, exportFormats string, destDir string) error {
+	if exportFormats == "" {
+		return fmt.Errorf("An error occurred: '%s' is a Google Docs file, use --export-format to download it\n", info.Name)
+	}
+
+	mimeType, ext, err := gdrive.PickExportFormat(info.MimeType, exportFormats)
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+
+	getRate := util.MeasureTransferRate()
+
+	var res *http.Response
+	err = gdrive.Pace(func() (err error) {
+		res, err = d.Files.Export(info.Id, mimeType).Download()
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+	defer res.Body.Close()
+
+	if stdout {
+		io.Copy(os.Stdout, res.Body)
+		return nil
+	}
+
+	path := util.UniquePath(filepath.Join(destDir, fmt.Sprintf("%s.%s", info.Name, ext)))
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+	defer outFile.Close()
+
+	bytes, err := io.Copy(outFile, res.Body)
+	if err != nil {
+		return fmt.Errorf("An error occurred: %s", err)
+	}
+
+	fmt.Printf("Downloaded '%s' at %s, total %s\n", path, getRate(bytes), util.FileSizeFormat(bytes))
+	return nil
+}
+
+// downloadFolder recreates folder as a local directory under destParent and
+// recurses into its children. visited guards against folder loops (a file
+// can have more than one parent on shared drives). exportFormats is passed
+// through to downloadFileTo so embedded Google Docs/Sheets/Slides files are
+// exported rather than skipped. downloaded tracks which Drive file ids have
+// already been fetched across the whole tree, so a file with more than one
+// parent is only downloaded once.
+func downloadFolder(d *gdrive.Drive, folder *drive.File, destParent string, visited map[string]bool, exportFormats string, downloaded map[string]bool) error {
+	if visited[folder.Id] {
+		return nil
+	}
+	visited[folder.Id] = true
+
+	destDir := util.UniquePath(filepath.Join(destParent, folder.Name))
+	if err := os.Mkdir(destDir, 0755); err != nil {
+		return fmt.Errorf("An error occurred creating '%s': %v\n", destDir, err)
+	}
+
+	q := fmt.Sprintf("'%s' in parents and trashed=false", folder.Id)
+	var list *drive.FileList
+	err := gdrive.Pace(func() (err error) {
+		list, err = scopedList(d).Q(q).Fields(googleapi.Field(listFields)).Do()
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+
+	for _, child := range list.Files {
+		if child.MimeType == gdrive.FolderMimeType {
+			if err := downloadFolder(d, child, destDir, visited, exportFormats, downloaded); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := downloadFileTo(d, child, destDir, exportFormats, downloaded); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Downloaded folder '%s'\n", destDir)
+	return nil
+}
+
+// downloadFileTo downloads a single non-folder file into destDir,
+// disambiguating its name if a sibling with the same name was already
+// written (Drive, unlike a filesystem, allows duplicate names in one
+// folder). exportFormats is routed to exportDownload for native Google
+// Docs/Sheets/Slides children instead of skipping them outright. downloaded
+// is keyed by Drive file id rather than local path, so a same-name,
+// same-content sibling with a different id is never mistaken for a file
+// this run already wrote and still gets its own disambiguated copy.
+func downloadFileTo(d *gdrive.Drive, info *drive.File, destDir string, exportFormats string, downloaded map[string]bool) error {
+	if downloaded[info.Id] {
+		fmt.Printf("Skipping '%s': already downloaded\n", info.Name)
+		return nil
+	}
+
+	if isGoogleAppsMimeType(info.MimeType) {
+		if exportFormats == "" {
+			fmt.Printf("Skipping '%s': Google Docs files require --export-format\n", info.Name)
+			return nil
+		}
+		if err := exportDownload(d, info, false, exportFormats, destDir); err != nil {
+			return err
+		}
+		downloaded[info.Id] = true
+		return nil
+	}
+
+	target := filepath.Join(destDir, info.Name)
+
+	getRate := util.MeasureTransferRate()
+
+	var res *http.Response
+	err := gdrive.Pace(func() (err error) {
+		res, err = scopedGet(d, info.Id).Download()
+		return
+	})
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+	defer res.Body.Close()
+
+	path := util.UniquePath(target)
+	outFile, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("An error occurred: %v\n", err)
+	}
+	defer outFile.Close()
+
+	bytes, err := io.Copy(outFile, res.Body)
+	if err != nil {
+		return fmt.Errorf("An error occurred: %s", err)
+	}
+
+	fmt.Printf("Downloaded '%s' at %s, total %s\n", path, getRate(bytes), util.FileSizeFormat(bytes))
+	downloaded[info.Id] = true
+	return nil
+}
+
 // Delete file with given file id
 func Delete(d *gdrive.Drive, fileId string) error {
-	info, err := d.Files.Get(fileId).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedGet(d, fileId).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
-	if err := d.Files.Delete(fileId).Do(); err != nil {
+	if err := gdrive.Pace(func() error { return scopedDelete(d, fileId).Do() }); err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 
 	}
 
-	fmt.Printf("Removed file '%s'\n", info.Title)
+	fmt.Printf("Removed file '%s'\n", info.Name)
 	return nil
 }
 
 // Make given file id readable by anyone -- auth not required to view/download file
 func Share(d *gdrive.Drive, fileId string) error {
-	info, err := d.Files.Get(fileId).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedGet(d, fileId).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
 	perm := &drive.Permission{
-		Value: "me",
-		Type:  "anyone",
-		Role:  "reader",
+		Type: "anyone",
+		Role: "reader",
 	}
 
-	if _, err := d.Permissions.Insert(fileId, perm).Do(); err != nil {
+	if err := gdrive.Pace(func() error { _, err := scopedPermCreate(d, fileId, perm).Do(); return err }); err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
-	fmt.Printf("File '%s' is now readable by everyone @ %s\n", info.Title, util.PreviewUrl(fileId))
+	fmt.Printf("File '%s' is now readable by everyone @ %s\n", info.Name, util.PreviewUrl(fileId))
 	return nil
 }
 
 // Removes the 'anyone' permission -- auth will be required to view/download file
 func Unshare(d *gdrive.Drive, fileId string) error {
-	info, err := d.Files.Get(fileId).Do()
+	var info *drive.File
+	err := gdrive.Pace(func() (err error) {
+		info, err = scopedGet(d, fileId).Fields(googleapi.Field(infoFields)).Do()
+		return
+	})
 	if err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
-	if err := d.Permissions.Delete(fileId, "anyone").Do(); err != nil {
+	if err := gdrive.Pace(func() error { return scopedPermDelete(d, fileId, "anyone").Do() }); err != nil {
 		return fmt.Errorf("An error occurred: %v\n", err)
 	}
 
-	fmt.Printf("File '%s' is no longer shared to 'anyone'\n", info.Title)
+	fmt.Printf("File '%s' is no longer shared to 'anyone'\n", info.Name)
 	return nil
 }
 
 func isShared(d *gdrive.Drive, fileId string) bool {
-	r, err := d.Permissions.List(fileId).Do()
+	var r *drive.PermissionList
+	err := gdrive.Pace(func() (err error) {
+		r, err = scopedPermList(d, fileId).Do()
+		return
+	})
 	if err != nil {
 		fmt.Printf("An error occurred: %v\n", err)
 		os.Exit(1)
 	}
 
-	for _, perm := range r.Items {
+	for _, perm := range r.Permissions {
 		if perm.Type == "anyone" {
 			return true
 		}
 	}
 	return false
 }
+
+// ChangesPull reports every add/modify/delete Drive has recorded since the
+// last call, tracked via stateFile, so a folder can be mirrored
+// incrementally instead of re-listing it from scratch each time.
+func ChangesPull(d *gdrive.Drive, stateFile string) error {
+	return gdrive.Changes(d, stateFile, func(event gdrive.ChangeEvent) error {
+		switch event.Action {
+		case gdrive.ChangeDeleted:
+			fmt.Printf("- %s\n", event.FileId)
+		case gdrive.ChangeAdded:
+			fmt.Printf("+ %s (%s)\n", event.File.Name, event.FileId)
+		case gdrive.ChangeModified:
+			fmt.Printf("* %s (%s)\n", event.File.Name, event.FileId)
+		}
+		return nil
+	})
+}
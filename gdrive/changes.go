@@ -0,0 +1,134 @@
+package gdrive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// Change actions reported by Changes.
+const (
+	ChangeAdded    = "add"
+	ChangeModified = "modify"
+	ChangeDeleted  = "delete"
+)
+
+// ChangeEvent describes a single file that changed since the last Changes
+// call.
+type ChangeEvent struct {
+	FileId string
+	Action string
+	File   *drive.File
+}
+
+// changesState is what Changes persists to stateFile between runs: the
+// page token to resume from, and the set of file ids already seen, so a
+// first sighting of a file can be reported as an add rather than a modify.
+type changesState struct {
+	StartPageToken string          `json:"startPageToken"`
+	Seen           map[string]bool `json:"seen"`
+}
+
+// Changes pages through Drive's changes.list feed, resuming from wherever
+// stateFile left off. On a first run (no state file yet) it only records
+// the current start page token, since there's no prior point to diff
+// against. On later runs it calls handler for every add/modify/delete it
+// finds, then persists the new start page token -- only once every event
+// has been handled, so a crash mid-run re-delivers the same batch next
+// time instead of silently skipping it.
+func Changes(d *Drive, stateFile string, handler func(ChangeEvent) error) error {
+	state, err := loadChangesState(stateFile)
+	if err != nil {
+		return err
+	}
+
+	if state.StartPageToken == "" {
+		var token *drive.StartPageToken
+		err := Pace(func() (err error) {
+			token, err = d.Changes.GetStartPageToken().Do()
+			return
+		})
+		if err != nil {
+			return err
+		}
+		state.StartPageToken = token.StartPageToken
+		return saveChangesState(stateFile, state)
+	}
+
+	pageToken := state.StartPageToken
+	for {
+		call := d.Changes.List(pageToken).IncludeRemoved(true).
+			Fields("nextPageToken,newStartPageToken,changes(fileId,removed,file(id,name,size,md5Checksum,trashed,modifiedTime,mimeType))")
+		if d.TeamDriveScoped() {
+			call = call.SupportsAllDrives(true).IncludeItemsFromAllDrives(true)
+		}
+
+		var list *drive.ChangeList
+		err := Pace(func() (err error) {
+			list, err = call.Do()
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, change := range list.Changes {
+			event := ChangeEvent{FileId: change.FileId, File: change.File}
+
+			switch {
+			case change.Removed || (change.File != nil && change.File.Trashed):
+				event.Action = ChangeDeleted
+				delete(state.Seen, change.FileId)
+			case state.Seen[change.FileId]:
+				event.Action = ChangeModified
+			default:
+				event.Action = ChangeAdded
+				state.Seen[change.FileId] = true
+			}
+
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+
+		if list.NextPageToken != "" {
+			pageToken = list.NextPageToken
+			continue
+		}
+
+		state.StartPageToken = list.NewStartPageToken
+		return saveChangesState(stateFile, state)
+	}
+}
+
+func loadChangesState(stateFile string) (*changesState, error) {
+	state := &changesState{Seen: make(map[string]bool)}
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Seen == nil {
+		state.Seen = make(map[string]bool)
+	}
+	return state, nil
+}
+
+func saveChangesState(stateFile string, state *changesState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stateFile, data, 0600)
+}
@@ -0,0 +1,58 @@
+package gdrive
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExportMimeTypes maps a file extension to the mime type Files.Export
+// should be asked to convert a native Google Docs/Sheets/Slides file into.
+var ExportMimeTypes = map[string]string{
+	"docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"odt":  "application/vnd.oasis.opendocument.text",
+	"ods":  "application/vnd.oasis.opendocument.spreadsheet",
+	"pdf":  "application/pdf",
+	"txt":  "text/plain",
+	"html": "text/html",
+	"csv":  "text/csv",
+	"tsv":  "text/tab-separated-values",
+	"epub": "application/epub+zip",
+	"svg":  "image/svg+xml",
+	"jpg":  "image/jpeg",
+	"png":  "image/png",
+}
+
+// exportableFormats lists, per native Google Docs mime type, the extensions
+// Files.Export actually supports for that document type. A doc mime type
+// missing from this map (a format Drive adds after this list was written)
+// isn't filtered at all, so PickExportFormat falls back to trying whatever
+// the user asked for in order.
+var exportableFormats = map[string]map[string]bool{
+	"application/vnd.google-apps.document":     {"docx": true, "odt": true, "pdf": true, "txt": true, "html": true, "epub": true},
+	"application/vnd.google-apps.spreadsheet":  {"xlsx": true, "ods": true, "pdf": true, "csv": true, "tsv": true, "html": true},
+	"application/vnd.google-apps.presentation": {"pptx": true, "pdf": true, "txt": true},
+	"application/vnd.google-apps.drawing":      {"jpg": true, "png": true, "svg": true, "pdf": true},
+}
+
+// PickExportFormat takes the mime type of a native Google Docs/Sheets/Slides
+// file and a comma separated list of extensions, as passed to
+// --export-format, and returns the mime type and extension of the first
+// candidate Drive knows how to export that document as. This lets a single
+// --export-format list (e.g. "docx,xlsx,pptx") work across a mix of document
+// types in one run, falling through to the next candidate instead of asking
+// Files.Export for a combination it would reject.
+func PickExportFormat(docMimeType, formats string) (mimeType, ext string, err error) {
+	supported := exportableFormats[docMimeType]
+	for _, candidate := range strings.Split(formats, ",") {
+		candidate = strings.ToLower(strings.TrimSpace(candidate))
+		if supported != nil && !supported[candidate] {
+			continue
+		}
+		if mimeType, ok := ExportMimeTypes[candidate]; ok {
+			return mimeType, candidate, nil
+		}
+	}
+	return "", "", fmt.Errorf("no supported export format found in '%s'", formats)
+}
@@ -0,0 +1,55 @@
+// Package gdrive wraps the generated Drive API v3 service with the small
+// amount of extra state (the underlying http.Client, optional Team Drive
+// scoping) that the cli package needs but which drive.Service does not
+// expose directly.
+package gdrive
+
+import (
+	"net/http"
+
+	drive "google.golang.org/api/drive/v3"
+)
+
+// FileFields is a partial field mask for file resources, so that large
+// listings don't pull back the full resource (description, every
+// permission, thumbnail links, ...) for every file. No call in this
+// repository applies it; the cli package's Files.List calls use their own
+// listFields mask.
+const FileFields = "id,name,size,md5Checksum,trashed,modifiedTime,mimeType,parents"
+
+// FolderMimeType is the mime type Drive uses for folders.
+const FolderMimeType = "application/vnd.google-apps.folder"
+
+// GoogleAppsMimePrefix identifies Drive's native Docs/Sheets/Slides/etc
+// formats, which have no binary content of their own and must be exported
+// rather than downloaded directly.
+const GoogleAppsMimePrefix = "application/vnd.google-apps."
+
+type Drive struct {
+	*drive.Service
+	client *http.Client
+
+	// TeamDriveId, when set, scopes every Files/Permissions call this Drive
+	// makes to that Shared Drive. AllDrives scopes List calls across every
+	// Shared Drive the user belongs to instead of a specific one.
+	TeamDriveId string
+	AllDrives   bool
+}
+
+func NewDrive(client *http.Client) (*Drive, error) {
+	service, err := drive.New(client)
+	if err != nil {
+		return nil, err
+	}
+	return &Drive{service, client, "", false}, nil
+}
+
+func (self *Drive) Client() *http.Client {
+	return self.client
+}
+
+// TeamDriveScoped reports whether Files/Permissions calls need the Shared
+// Drive parameters (supportsAllDrives, etc) applied at all.
+func (self *Drive) TeamDriveScoped() bool {
+	return self.TeamDriveId != "" || self.AllDrives
+}
@@ -0,0 +1,86 @@
+package gdrive
+
+import (
+	"math"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	pacerMinSleep = 10 * time.Millisecond
+	pacerMaxSleep = 2 * time.Second
+	pacerDecay    = 2
+	pacerRetries  = 10
+)
+
+// rateLimitReasons are the googleapi.Error reasons Drive uses on a 403 to
+// mean "you've been rate limited", as opposed to "you don't have access" --
+// only the former is worth retrying.
+var rateLimitReasons = map[string]bool{
+	"userRateLimitExceeded": true,
+	"rateLimitExceeded":     true,
+}
+
+// Pace retries fn, which should perform a single API call and return
+// whatever error it produced, on Drive's retryable errors: a 403 with a
+// rate-limit reason, 408, 429, 500, 502, 503 or 504. It sleeps with
+// exponential backoff between attempts, honoring a Retry-After header given
+// in seconds when the server sends one, and gives up after pacerRetries
+// attempts.
+func Pace(fn func() error) error {
+	var err error
+	for attempt := 0; attempt < pacerRetries; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+		if !isRetryable(err) {
+			return err
+		}
+		time.Sleep(retryDelay(err, attempt))
+	}
+	return err
+}
+
+func isRetryable(err error) bool {
+	apiErr, ok := err.(*googleapi.Error)
+	if !ok {
+		return false
+	}
+
+	switch apiErr.Code {
+	case 408, 429, 500, 502, 503, 504:
+		return true
+	case 403:
+		for _, item := range apiErr.Errors {
+			if rateLimitReasons[item.Reason] {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+// retryDelay honors the server's Retry-After header if it sent one as a
+// number of seconds (an HTTP-date value is not parsed), otherwise falls back
+// to min(maxSleep, minSleep * decay^attempt) plus a little jitter.
+func retryDelay(err error, attempt int) time.Duration {
+	if apiErr, ok := err.(*googleapi.Error); ok {
+		if retryAfter := apiErr.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, parseErr := strconv.Atoi(retryAfter); parseErr == nil {
+				return time.Duration(seconds) * time.Second
+			}
+		}
+	}
+
+	delay := time.Duration(float64(pacerMinSleep) * math.Pow(pacerDecay, float64(attempt)))
+	if delay > pacerMaxSleep {
+		delay = pacerMaxSleep
+	}
+	return delay + time.Duration(rand.Int63n(int64(pacerMinSleep)))
+}
@@ -0,0 +1,289 @@
+package gdrive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/googleapi"
+)
+
+// Chunk sizes for resumable uploads. Google's resumable protocol requires
+// every chunk but the last to be a multiple of 256 KiB.
+const (
+	MinChunkSize     = 256 * 1024
+	MaxChunkSize     = 8 * 1024 * 1024
+	DefaultChunkSize = 4 * 1024 * 1024
+)
+
+const uploadEndpoint = "https://www.googleapis.com/upload/drive/v3/files?uploadType=resumable"
+
+// ProgressFunc is called after each chunk of a resumable upload is
+// confirmed by the server, with the total number of bytes sent so far.
+type ProgressFunc func(offset int64)
+
+// resumableSession is the on-disk record of an in-progress resumable
+// upload: the session URI Drive handed back from the initiating POST, and
+// the last byte offset we know the server has accepted.
+type resumableSession struct {
+	Uri    string `json:"uri"`
+	Offset int64  `json:"offset"`
+}
+
+// DefaultUploadStateFile returns the path gdrive uses to persist resumable
+// upload sessions across process restarts, creating its parent directory
+// if necessary.
+func DefaultUploadStateFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.TempDir()
+	}
+	dir := filepath.Join(home, ".gdrive")
+	os.MkdirAll(dir, 0700)
+	return filepath.Join(dir, "upload-state.json")
+}
+
+// ResumableUpload uploads the contents of file in fixed-size chunks. The
+// session URI is persisted to stateFile, keyed by the file's path, size and
+// modification time, so that an interrupted upload resumes from the
+// server-reported offset instead of starting over on the next call.
+func (self *Drive) ResumableUpload(meta *drive.File, file *os.File, chunkSize int64, stateFile string, progress ProgressFunc) (*drive.File, error) {
+	chunkSize = clampChunkSize(chunkSize)
+
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	total := fi.Size()
+	key := sessionKey(file.Name(), total, fi.ModTime())
+
+	state, err := loadUploadState(stateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	session, ok := state[key]
+	if !ok {
+		uri, err := self.initiateResumableSession(meta)
+		if err != nil {
+			return nil, err
+		}
+		session = resumableSession{Uri: uri}
+	}
+
+	for {
+		end := session.Offset + chunkSize
+		if end > total {
+			end = total
+		}
+
+		chunk := make([]byte, end-session.Offset)
+		if _, err := file.ReadAt(chunk, session.Offset); err != nil {
+			return nil, err
+		}
+
+		info, offset, done, err := self.putChunk(session.Uri, chunk, session.Offset, end, total, meta.MimeType)
+		if err != nil {
+			return nil, err
+		}
+
+		session.Offset = offset
+		state[key] = session
+		if err := saveUploadState(stateFile, state); err != nil {
+			return nil, err
+		}
+
+		if progress != nil {
+			progress(session.Offset)
+		}
+
+		if done {
+			delete(state, key)
+			saveUploadState(stateFile, state)
+			return info, nil
+		}
+	}
+}
+
+func clampChunkSize(chunkSize int64) int64 {
+	if chunkSize < MinChunkSize {
+		chunkSize = MinChunkSize
+	}
+	if chunkSize > MaxChunkSize {
+		chunkSize = MaxChunkSize
+	}
+	// Round down to a power of two; within the clamp above that is always a
+	// multiple of 256 KiB, as the resumable protocol requires.
+	pow := int64(1)
+	for pow*2 <= chunkSize {
+		pow *= 2
+	}
+	return pow
+}
+
+func sessionKey(path string, size int64, mtime time.Time) string {
+	return fmt.Sprintf("%s:%d:%d", path, size, mtime.UnixNano())
+}
+
+func loadUploadState(stateFile string) (map[string]resumableSession, error) {
+	state := make(map[string]resumableSession)
+
+	data, err := ioutil.ReadFile(stateFile)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return state, nil
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func saveUploadState(stateFile string, state map[string]resumableSession) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(stateFile, data, 0600)
+}
+
+// initiateResumableSession performs the initial POST that hands back the
+// session URI subsequent chunk PUTs are sent to.
+func (self *Drive) initiateResumableSession(meta *drive.File) (string, error) {
+	body, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := uploadEndpoint
+	if self.TeamDriveScoped() {
+		endpoint += "&supportsAllDrives=true"
+	}
+
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	if meta.MimeType != "" {
+		req.Header.Set("X-Upload-Content-Type", meta.MimeType)
+	}
+
+	res, err := self.Client().Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		errBody, _ := ioutil.ReadAll(res.Body)
+		return "", fmt.Errorf("resumable upload: failed to start session (%d): %s", res.StatusCode, errBody)
+	}
+
+	location := res.Header.Get("Location")
+	if location == "" {
+		return "", fmt.Errorf("resumable upload: server did not return a session uri")
+	}
+	return location, nil
+}
+
+// putChunk PUTs a single chunk, going through Pace so it retries on the same
+// 403/408/429/500/502/503/504 conditions (and with the same backoff) as
+// every other API call. It returns the confirmed offset and, once the server has seen the
+// whole file, the created drive.File.
+func (self *Drive) putChunk(uri string, chunk []byte, start, end, total int64, mimeType string) (*drive.File, int64, bool, error) {
+	var offset int64
+	var file *drive.File
+
+	err := Pace(func() error {
+		req, err := http.NewRequest("PUT", uri, bytes.NewReader(chunk))
+		if err != nil {
+			return err
+		}
+		req.ContentLength = int64(len(chunk))
+		req.Header.Set("Content-Type", mimeType)
+		req.Header.Set("Content-Range", contentRangeHeader(start, end, total))
+
+		res, err := self.Client().Do(req)
+		if err != nil {
+			return err
+		}
+
+		offset, file, err = parseChunkResponse(res, start, end)
+		return err
+	})
+	if err != nil {
+		return nil, start, false, err
+	}
+	return file, offset, file != nil, nil
+}
+
+// contentRangeHeader builds the Content-Range header for a chunk PUT. An
+// empty file has no bytes to range over, so the resumable protocol wants
+// "bytes */0" to finalize it rather than the malformed "bytes 0--1/0" the
+// plain start-end/total form would produce when total is 0.
+func contentRangeHeader(start, end, total int64) string {
+	if total == 0 {
+		return "bytes */0"
+	}
+	return fmt.Sprintf("bytes %d-%d/%d", start, end-1, total)
+}
+
+// parseChunkResponse reads a chunk PUT's response. 308 means the server
+// confirms receipt of a partial chunk and expects more; anything else not in
+// the 2xx range is converted to a *googleapi.Error so Pace can decide
+// whether it's retryable the same way it does for every generated API call.
+func parseChunkResponse(res *http.Response, start, end int64) (offset int64, file *drive.File, err error) {
+	defer res.Body.Close()
+
+	if res.StatusCode == 308 {
+		if offset, ok := parseRangeEnd(res.Header.Get("Range")); ok {
+			return offset + 1, nil, nil
+		}
+		// No (or malformed) Range header means the server hasn't recorded
+		// any bytes from this chunk yet -- stay at start so the next
+		// iteration retries it instead of skipping past it.
+		return start, nil, nil
+	}
+
+	if err := googleapi.CheckResponse(res); err != nil {
+		return 0, nil, err
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, nil, err
+	}
+	f := &drive.File{}
+	if err := json.Unmarshal(body, f); err != nil {
+		return 0, nil, err
+	}
+	return end, f, nil
+}
+
+// parseRangeEnd extracts the end offset from a "bytes=0-12345" style Range
+// header, as returned on a 308 resume-incomplete response.
+func parseRangeEnd(rangeHeader string) (int64, bool) {
+	parts := strings.SplitN(rangeHeader, "-", 2)
+	if len(parts) != 2 {
+		return 0, false
+	}
+	end, err := strconv.ParseInt(strings.TrimSpace(parts[1]), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return end, true
+}
@@ -0,0 +1,156 @@
+// Package util holds small formatting and filesystem helpers shared by the
+// cli package. Nothing here talks to the Drive API.
+package util
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Print prints a single record as "Key: Value" lines, in the given order.
+func Print(values map[string]string, order []string) {
+	for _, key := range order {
+		fmt.Printf("%s: %s\n", key, values[key])
+	}
+}
+
+// PrintColumns prints a list of records as a left-aligned table.
+func PrintColumns(values []map[string]string, order []string, padding int, noHeader bool) {
+	widths := make(map[string]int)
+	for _, key := range order {
+		widths[key] = len(key)
+		for _, v := range values {
+			if l := len(v[key]); l > widths[key] {
+				widths[key] = l
+			}
+		}
+	}
+
+	if !noHeader {
+		row := make([]string, 0, len(order))
+		for _, key := range order {
+			row = append(row, fmt.Sprintf("%-*s", widths[key]+padding, key))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(row, ""), " "))
+	}
+
+	for _, v := range values {
+		row := make([]string, 0, len(order))
+		for _, key := range order {
+			row = append(row, fmt.Sprintf("%-*s", widths[key]+padding, v[key]))
+		}
+		fmt.Println(strings.TrimRight(strings.Join(row, ""), " "))
+	}
+}
+
+// TruncateString shortens str to maxLength runes, if necessary.
+func TruncateString(str string, maxLength int) string {
+	runes := []rune(str)
+	if len(runes) <= maxLength {
+		return str
+	}
+	return string(runes[:maxLength])
+}
+
+// FileSizeFormat renders a byte count as a human readable size, e.g. "4.2 MB".
+func FileSizeFormat(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	size := float64(bytes)
+	unit := 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", bytes, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", size, units[unit])
+}
+
+// ISODateToLocal converts an RFC3339 timestamp, as returned by the Drive API,
+// into the user's local timezone for display.
+func ISODateToLocal(isoDate string) string {
+	t, err := time.Parse(time.RFC3339, isoDate)
+	if err != nil {
+		return isoDate
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// ParentList renders a file's parent folder ids as a comma separated string.
+func ParentList(parents []string) string {
+	return strings.Join(parents, ", ")
+}
+
+// FormatBool renders a bool the way the cli prints flags ("true"/"false").
+func FormatBool(b bool) string {
+	return strconv.FormatBool(b)
+}
+
+// PreviewUrl returns the public preview link for a shared file.
+func PreviewUrl(fileId string) string {
+	return fmt.Sprintf("https://drive.google.com/file/d/%s/view", fileId)
+}
+
+// FileExists reports whether path exists on the local filesystem.
+func FileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Md5File returns the hex-encoded MD5 checksum of the file at path, in the
+// same format Drive reports in a File's Md5Checksum field, so the two can be
+// compared directly.
+func Md5File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// UniquePath returns path unchanged if nothing exists there yet, otherwise
+// it appends " (1)", " (2)", etc. before the extension until it finds a
+// name that's free. This mirrors what Drive allows (many files with the
+// same name in one folder) onto a filesystem that doesn't.
+func UniquePath(path string) string {
+	if !FileExists(path) {
+		return path
+	}
+
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if !FileExists(candidate) {
+			return candidate
+		}
+	}
+}
+
+// MeasureTransferRate returns a function that, given a byte count, reports
+// the average transfer rate since MeasureTransferRate was called.
+func MeasureTransferRate() func(int64) string {
+	start := time.Now()
+	return func(bytes int64) string {
+		seconds := time.Since(start).Seconds()
+		if seconds <= 0 {
+			seconds = 1
+		}
+		rate := float64(bytes) / seconds
+		return fmt.Sprintf("%s/s", FileSizeFormat(int64(rate)))
+	}
+}